@@ -0,0 +1,176 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+/*
+BatchPath returns the deduplicated, minimal set of node hashes needed to
+prove inclusion of every leaf in indices, all at once: for any subtree none
+of indices fall in, only its root hash is included, rather than repeating
+it once per requested leaf the way N independent Path calls would.
+
+The tree is walked with the same RFC 6962 decomposition as Path and Proof:
+at each node, if every requested index falls on one side, BatchPath
+recurses into that side alone and adds the other side's whole subtree hash
+to the proof; if indices fall on both sides, it recurses into both and adds
+nothing extra at this level. The resulting order is the post-order
+traversal of the nodes visited -- children's hashes always precede their
+parent's contribution -- which is what VerifyBatchInclusion expects to
+consume.
+*/
+func (t *Tree) BatchPath(indices []uint64) Path {
+	requested := make(map[uint64]bool, len(indices))
+	for _, index := range indices {
+		if index < t.size {
+			requested[index] = true
+		}
+	}
+	if len(requested) == 0 {
+		return Path{}
+	}
+	return t.batchPath(requested, 0, t.size)
+}
+
+func (t *Tree) batchPath(requested map[uint64]bool, start, n uint64) Path {
+	if n == 1 {
+		return Path{}
+	}
+
+	k := largestPowerOf2LessThan(n)
+	left, right := false, false
+	for index := range requested {
+		if index < start || index >= start+n {
+			continue
+		}
+		if index < start+k {
+			left = true
+		} else {
+			right = true
+		}
+	}
+
+	switch {
+	case left && !right:
+		p := t.batchPath(requested, start, k)
+		return append(p, t.subMTH(start+k, n-k))
+	case right && !left:
+		p := t.batchPath(requested, start+k, n-k)
+		return append(p, t.subMTH(start, k))
+	default:
+		p := t.batchPath(requested, start, k)
+		p = append(p, t.batchPath(requested, start+k, n-k)...)
+		return p
+	}
+}
+
+// VerifyBatchInclusion checks that proof, together with the given leaves,
+// reconstructs root for a tree of size treeSize, using c's Hasher
+// (RFC6962SHA256 if c.Hasher is nil). leaves maps each proven leaf's index
+// to its raw entry data; every index it contains must be less than
+// treeSize.
+func (c TreeConfig) VerifyBatchInclusion(leaves map[uint64][]byte, treeSize uint64, root []byte, proof Path) error {
+	if treeSize == 0 {
+		return errors.New("merkletree: tree is empty")
+	}
+	if len(leaves) == 0 {
+		return errors.New("merkletree: no leaves to verify")
+	}
+
+	requested := make(map[uint64]bool, len(leaves))
+	for index := range leaves {
+		if index >= treeSize {
+			return fmt.Errorf("merkletree: leaf index %d out of range", index)
+		}
+		requested[index] = true
+	}
+
+	hasher := c.hasher()
+	cursor := 0
+	nextProofHash := func() ([]byte, error) {
+		if cursor >= len(proof) {
+			return nil, errors.New("merkletree: batch inclusion proof is too short")
+		}
+		h := proof[cursor]
+		cursor++
+		return h, nil
+	}
+
+	var verify func(start, n uint64) ([]byte, error)
+	verify = func(start, n uint64) ([]byte, error) {
+		if n == 1 {
+			leaf, ok := leaves[start]
+			if !ok {
+				return nil, fmt.Errorf("merkletree: missing leaf for index %d", start)
+			}
+			return hasher.HashLeaf(leaf), nil
+		}
+
+		k := largestPowerOf2LessThan(n)
+		left, right := false, false
+		for index := range requested {
+			if index < start || index >= start+n {
+				continue
+			}
+			if index < start+k {
+				left = true
+			} else {
+				right = true
+			}
+		}
+
+		switch {
+		case left && !right:
+			lh, err := verify(start, k)
+			if err != nil {
+				return nil, err
+			}
+			rh, err := nextProofHash()
+			if err != nil {
+				return nil, err
+			}
+			return hasher.HashChildren(lh, rh), nil
+		case right && !left:
+			rh, err := verify(start+k, n-k)
+			if err != nil {
+				return nil, err
+			}
+			lh, err := nextProofHash()
+			if err != nil {
+				return nil, err
+			}
+			return hasher.HashChildren(lh, rh), nil
+		default:
+			lh, err := verify(start, k)
+			if err != nil {
+				return nil, err
+			}
+			rh, err := verify(start+k, n-k)
+			if err != nil {
+				return nil, err
+			}
+			return hasher.HashChildren(lh, rh), nil
+		}
+	}
+
+	got, err := verify(0, treeSize)
+	if err != nil {
+		return err
+	}
+	if cursor != len(proof) {
+		return errors.New("merkletree: batch inclusion proof has too many elements")
+	}
+	if !bytes.Equal(got, root) {
+		return errors.New("merkletree: calculated root does not match given root")
+	}
+	return nil
+}
+
+// VerifyBatchInclusion checks a batch inclusion proof using RFC6962SHA256.
+// It is a convenience wrapper around TreeConfig{}.VerifyBatchInclusion for
+// callers that do not need an alternate Hasher.
+func VerifyBatchInclusion(leaves map[uint64][]byte, treeSize uint64, root []byte, proof Path) error {
+	return TreeConfig{}.VerifyBatchInclusion(leaves, treeSize, root, proof)
+}
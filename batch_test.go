@@ -0,0 +1,54 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchPathVerifiesInclusion(t *testing.T) {
+	D := makeleaves()
+	tree := NewTree(D)
+	root := tree.Hash()
+
+	for _, indices := range [][]uint64{
+		{0},
+		{0, 3},
+		{4, 6},
+		{0, 1, 2, 3, 4, 5, 6},
+		{2, 5},
+	} {
+		proof := tree.BatchPath(indices)
+
+		leaves := make(map[uint64][]byte, len(indices))
+		for _, i := range indices {
+			leaves[i] = D[i]
+		}
+		assert.NoErrorf(t, VerifyBatchInclusion(leaves, uint64(len(D)), root, proof), "indices=%v", indices)
+	}
+}
+
+func TestBatchPathSmallerThanIndependentPaths(t *testing.T) {
+	D := makeleaves()
+	tree := NewTree(D)
+
+	indices := []uint64{0, 1, 2, 3}
+	batch := tree.BatchPath(indices)
+
+	var independent int
+	for _, i := range indices {
+		independent += len(tree.Path(i))
+	}
+	assert.Less(t, len(batch), independent)
+}
+
+func TestVerifyBatchInclusionRejectsWrongLeaf(t *testing.T) {
+	D := makeleaves()
+	tree := NewTree(D)
+	root := tree.Hash()
+
+	indices := []uint64{0, 3}
+	proof := tree.BatchPath(indices)
+	leaves := map[uint64][]byte{0: D[0], 3: []byte("not-d3")}
+	assert.Error(t, VerifyBatchInclusion(leaves, uint64(len(D)), root, proof))
+}
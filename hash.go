@@ -0,0 +1,131 @@
+package merkletree
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+)
+
+// Hasher abstracts the domain-separated hash function a Tree is built
+// over, so that alternate digest algorithms and alternate leaf/node
+// encodings can be plugged in without forking the tree logic itself.
+type Hasher interface {
+	// HashLeaf returns the hash of a single leaf entry.
+	HashLeaf(data []byte) []byte
+	// HashChildren returns the hash of an interior node given the hashes
+	// of its left and right children.
+	HashChildren(l, r []byte) []byte
+	// Size returns the digest size, in bytes, produced by this Hasher.
+	Size() int
+	// EmptyRoot returns the root hash of a tree with no entries.
+	EmptyRoot() []byte
+}
+
+// rfc6962Hasher implements Hasher as specified by RFC 6962 section 2.1: a
+// leaf hash is H(LeafPrefix || data) and a node hash is
+// H(NodePrefix || l || r), for the given underlying hash.Hash constructor.
+type rfc6962Hasher struct {
+	new func() hash.Hash
+}
+
+func (h rfc6962Hasher) HashLeaf(data []byte) []byte {
+	hh := h.new()
+	hh.Write([]byte{LeafPrefix})
+	hh.Write(data)
+	return hh.Sum(nil)
+}
+
+func (h rfc6962Hasher) HashChildren(l, r []byte) []byte {
+	hh := h.new()
+	hh.Write([]byte{NodePrefix})
+	hh.Write(l)
+	hh.Write(r)
+	return hh.Sum(nil)
+}
+
+func (h rfc6962Hasher) Size() int {
+	return h.new().Size()
+}
+
+func (h rfc6962Hasher) EmptyRoot() []byte {
+	return h.new().Sum(nil)
+}
+
+var (
+	// RFC6962SHA256 is the original RFC 6962 hasher: SHA-256 with 0x00/0x01
+	// leaf/node prefixes. This is the default Hasher used when no
+	// TreeConfig is given.
+	RFC6962SHA256 Hasher = rfc6962Hasher{new: sha256.New}
+
+	// RFC6962SHA512_256 is the RFC 6962 hasher using SHA-512/256 instead
+	// of SHA-256.
+	RFC6962SHA512_256 Hasher = rfc6962Hasher{new: sha512.New512_256}
+)
+
+const (
+	liskLeafPrefix   = byte(0x00)
+	liskBranchPrefix = byte(0x01)
+)
+
+// liskHasher is a Lisk-style Hasher: like rfc6962Hasher it separates leaf
+// and branch hashes with distinct prefixes, but it additionally encodes the
+// length of the leaf payload (as a big-endian uint64) ahead of the payload
+// itself, so that leaves of different lengths with a common prefix cannot
+// be confused with each other.
+type liskHasher struct{}
+
+func (liskHasher) HashLeaf(data []byte) []byte {
+	buf := make([]byte, 0, 1+8+len(data))
+	buf = append(buf, liskLeafPrefix)
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	buf = append(buf, length[:]...)
+	buf = append(buf, data...)
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
+
+func (liskHasher) HashChildren(l, r []byte) []byte {
+	buf := make([]byte, 0, 1+len(l)+len(r))
+	buf = append(buf, liskBranchPrefix)
+	buf = append(buf, l...)
+	buf = append(buf, r...)
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
+
+func (liskHasher) Size() int {
+	return sha256.Size
+}
+
+func (liskHasher) EmptyRoot() []byte {
+	sum := sha256.Sum256(nil)
+	return sum[:]
+}
+
+// LiskSHA256 is a Lisk-style Hasher: SHA-256 with distinct leaf/branch
+// prefixes and a length-prefixed leaf encoding.
+var LiskSHA256 Hasher = liskHasher{}
+
+// TreeConfig configures the Hasher and Storage a Tree is built with. The
+// zero value uses RFC6962SHA256 and an in-memory Storage, matching the
+// tree's original, hard-coded behavior.
+type TreeConfig struct {
+	Hasher  Hasher
+	Storage Storage
+}
+
+func (c TreeConfig) hasher() Hasher {
+	if c.Hasher != nil {
+		return c.Hasher
+	}
+	return RFC6962SHA256
+}
+
+func (c TreeConfig) storage() Storage {
+	if c.Storage != nil {
+		return c.Storage
+	}
+	return NewMemStorage()
+}
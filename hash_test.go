@@ -0,0 +1,32 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashersProduceVerifiableTrees(t *testing.T) {
+	D := makeleaves()
+
+	for _, hasher := range []Hasher{RFC6962SHA256, RFC6962SHA512_256, LiskSHA256} {
+		cfg := TreeConfig{Hasher: hasher}
+		tree := NewTree(D, cfg)
+		root := tree.Hash()
+		assert.Len(t, root, hasher.Size())
+
+		for i, d := range D {
+			path := tree.Path(uint64(i))
+			assert.NoError(t, cfg.VerifyInclusion(d, uint64(i), uint64(len(D)), root, path))
+		}
+
+		oldRoot := NewTree(D[:4], cfg).Hash()
+		proof := tree.Proof(4)
+		assert.NoError(t, cfg.VerifyConsistency(4, uint64(len(D)), oldRoot, root, proof))
+	}
+}
+
+func TestDefaultHasherIsRFC6962SHA256(t *testing.T) {
+	D := makeleaves()
+	assert.Equal(t, NewTree(D, TreeConfig{Hasher: RFC6962SHA256}).Hash(), NewTree(D).Hash())
+}
@@ -0,0 +1,122 @@
+// Implementation as per https://tools.ietf.org/html/rfc6962#section-3.5
+
+package merkletree
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SignedTreeHead is a signed commitment to the state of a tree at a given
+// size, corresponding to RFC 6962's Signed Tree Head (STH).
+type SignedTreeHead struct {
+	TreeSize  uint64
+	Timestamp int64
+	RootHash  [sha256.Size]byte
+	Signature []byte
+}
+
+const (
+	sthVersion       = byte(0) // v1, as in RFC 6962 section 3.2
+	sthSignatureType = byte(1) // tree_head, as in RFC 6962 section 3.2
+)
+
+// sthSignedPayload returns the RFC 6962 TLS-style serialization that an STH
+// signs over:
+//
+//	version || signature_type || timestamp || tree_size || root_hash
+func sthSignedPayload(treeSize uint64, timestamp int64, rootHash [sha256.Size]byte) []byte {
+	buf := make([]byte, 0, 2+8+8+sha256.Size)
+	buf = append(buf, sthVersion, sthSignatureType)
+	var tsBuf, sizeBuf [8]byte
+	binary.BigEndian.PutUint64(tsBuf[:], uint64(timestamp))
+	binary.BigEndian.PutUint64(sizeBuf[:], treeSize)
+	buf = append(buf, tsBuf[:]...)
+	buf = append(buf, sizeBuf[:]...)
+	buf = append(buf, rootHash[:]...)
+	return buf
+}
+
+/*
+SignHead produces a SignedTreeHead committing to t's size and root hash as
+of now, signed by signer over a SHA-256 digest of the RFC 6962 TLS-style STH
+payload. This matches how an ECDSA or RSA crypto.Signer is normally driven
+(sign a digest, not the raw message); plain ed25519 keys, which expect the
+unhashed message instead, are not supported.
+
+t's Hasher must produce 32-byte digests (RFC6962SHA256 and
+RFC6962SHA512_256 both do), since the STH root_hash field has a fixed size.
+*/
+func (t *Tree) SignHead(signer crypto.Signer, now time.Time) (*SignedTreeHead, error) {
+	root := t.Hash()
+	if len(root) != sha256.Size {
+		return nil, fmt.Errorf("merkletree: SignHead requires a %d-byte root hash, got %d", sha256.Size, len(root))
+	}
+	var rootHash [sha256.Size]byte
+	copy(rootHash[:], root)
+
+	timestamp := now.UnixMilli()
+	digest := sha256.Sum256(sthSignedPayload(t.size, timestamp, rootHash))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("merkletree: signing STH: %w", err)
+	}
+
+	return &SignedTreeHead{
+		TreeSize:  t.size,
+		Timestamp: timestamp,
+		RootHash:  rootHash,
+		Signature: sig,
+	}, nil
+}
+
+// VerifySTH checks that sth carries a valid signature from pub over its
+// RFC 6962 TLS-style payload. pub must be an *ecdsa.PublicKey or
+// *rsa.PublicKey, matching the digest-based signing SignHead performs.
+func VerifySTH(sth *SignedTreeHead, pub crypto.PublicKey) error {
+	digest := sha256.Sum256(sthSignedPayload(sth.TreeSize, sth.Timestamp, sth.RootHash))
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sth.Signature) {
+			return errors.New("merkletree: STH signature verification failed")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sth.Signature); err != nil {
+			return fmt.Errorf("merkletree: STH signature verification failed: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("merkletree: unsupported STH public key type %T", pub)
+	}
+}
+
+// NewSTHConsistency checks that proof demonstrates that old and new commit
+// to a consistent, append-only tree history, i.e. that new's tree is old's
+// tree with only entries appended, using c's Hasher (RFC6962SHA256 if
+// c.Hasher is nil -- this must match the Hasher the trees were actually
+// built with, since otherwise a genuinely consistent proof will fail to
+// verify). It assumes old and new have already each been authenticated with
+// VerifySTH; it only checks the consistency proof between their root
+// hashes.
+func (c TreeConfig) NewSTHConsistency(old, new *SignedTreeHead, proof Path) error {
+	if new.TreeSize < old.TreeSize {
+		return errors.New("merkletree: new STH has a smaller tree size than old STH")
+	}
+	return c.VerifyConsistency(old.TreeSize, new.TreeSize, old.RootHash[:], new.RootHash[:], proof)
+}
+
+// NewSTHConsistency checks an STH consistency proof using RFC6962SHA256. It
+// is a convenience wrapper around TreeConfig{}.NewSTHConsistency for callers
+// that do not need an alternate Hasher.
+func NewSTHConsistency(old, new *SignedTreeHead, proof Path) error {
+	return TreeConfig{}.NewSTHConsistency(old, new, proof)
+}
@@ -0,0 +1,74 @@
+package merkletree
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerifySTH(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	D := makeleaves()
+	tree := NewTree(D)
+
+	sth, err := tree.SignHead(priv, time.Unix(1700000000, 0))
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(D), sth.TreeSize)
+
+	assert.NoError(t, VerifySTH(sth, &priv.PublicKey))
+
+	// Tampering with the signed size must invalidate the signature.
+	tampered := *sth
+	tampered.TreeSize++
+	assert.Error(t, VerifySTH(&tampered, &priv.PublicKey))
+}
+
+func TestNewSTHConsistency(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	D := makeleaves()
+	now := time.Unix(1700000000, 0)
+
+	oldTree := NewTree(D[:4])
+	oldSTH, err := oldTree.SignHead(priv, now)
+	assert.NoError(t, err)
+
+	newTree := NewTree(D)
+	newSTH, err := newTree.SignHead(priv, now.Add(time.Hour))
+	assert.NoError(t, err)
+
+	proof := newTree.Proof(4)
+	assert.NoError(t, NewSTHConsistency(oldSTH, newSTH, proof))
+}
+
+func TestNewSTHConsistencyWithAlternateHasher(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	D := makeleaves()
+	now := time.Unix(1700000000, 0)
+	cfg := TreeConfig{Hasher: RFC6962SHA512_256}
+
+	oldTree := NewTree(D[:4], cfg)
+	oldSTH, err := oldTree.SignHead(priv, now)
+	assert.NoError(t, err)
+
+	newTree := NewTree(D, cfg)
+	newSTH, err := newTree.SignHead(priv, now.Add(time.Hour))
+	assert.NoError(t, err)
+
+	proof := newTree.Proof(4)
+
+	// The package-level NewSTHConsistency is hardwired to RFC6962SHA256, so
+	// a genuinely consistent proof built with a different Hasher must still
+	// fail to verify with it.
+	assert.Error(t, NewSTHConsistency(oldSTH, newSTH, proof))
+	assert.NoError(t, cfg.NewSTHConsistency(oldSTH, newSTH, proof))
+}
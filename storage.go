@@ -0,0 +1,233 @@
+package merkletree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Storage persists the node hashes and raw entries of a Tree so that it does
+// not need to keep its entire state in memory, and so that it can resume
+// after a process restart without recomputing anything. Implementations
+// must be safe for concurrent use.
+type Storage interface {
+	// Get returns the hash of the node rooting the perfect, 2^level-sized
+	// subtree at the given index, and whether it has been stored yet.
+	Get(level uint8, index uint64) ([]byte, bool)
+	// Put stores the hash of the node rooting the perfect, 2^level-sized
+	// subtree at the given index. Implementations may assume a given
+	// (level, index) is only ever stored once, since such a node's hash
+	// never changes once the tree is big enough to contain it.
+	Put(level uint8, index uint64, hash []byte)
+	// AppendEntry persists entry as the next leaf's raw data and returns
+	// the index assigned to it.
+	AppendEntry(entry []byte) (uint64, error)
+}
+
+// MemStorage is an in-memory Storage, equivalent to how Tree cached nodes
+// before a Storage backend existed. It is the default used when no
+// TreeConfig.Storage is given.
+type MemStorage struct {
+	mu      sync.RWMutex
+	nodes   map[nodeKey][]byte
+	entries [][]byte
+}
+
+// NewMemStorage returns an empty, in-memory Storage.
+func NewMemStorage() *MemStorage {
+	return &MemStorage{nodes: make(map[nodeKey][]byte)}
+}
+
+func (s *MemStorage) Get(level uint8, index uint64) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.nodes[nodeKey{level, index}]
+	return h, ok
+}
+
+func (s *MemStorage) Put(level uint8, index uint64, hash []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[nodeKey{level, index}] = hash
+}
+
+func (s *MemStorage) AppendEntry(entry []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := uint64(len(s.entries))
+	s.entries = append(s.entries, entry)
+	return index, nil
+}
+
+// Size returns the number of entries appended so far, letting OpenTree pick
+// up an existing MemStorage without re-probing it node by node.
+func (s *MemStorage) Size() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.entries))
+}
+
+// FileStorage is a disk-backed Storage. It keeps two append-only log files
+// in a directory: one of fixed-size (level, index, hash) node records, and
+// one of length-prefixed raw entries. Both logs are scanned once, on open,
+// to rebuild the in-memory index that Get and AppendEntry's return index
+// are served from; after that, Put and AppendEntry only ever append.
+type FileStorage struct {
+	mu sync.Mutex
+
+	hashSize int
+	nodes    map[nodeKey][]byte
+	nodesW   *os.File
+
+	entryCount uint64
+	entriesW   *os.File
+}
+
+// NewFileStorage opens (creating if necessary) a FileStorage rooted at dir,
+// for a Hasher producing hashSize-byte digests.
+func NewFileStorage(dir string, hashSize int) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	nodes, nodesW, err := openNodesLog(filepath.Join(dir, "nodes.log"), hashSize)
+	if err != nil {
+		return nil, err
+	}
+	entryCount, entriesW, err := openEntriesLog(filepath.Join(dir, "entries.log"))
+	if err != nil {
+		nodesW.Close()
+		return nil, err
+	}
+
+	return &FileStorage{
+		hashSize:   hashSize,
+		nodes:      nodes,
+		nodesW:     nodesW,
+		entryCount: entryCount,
+		entriesW:   entriesW,
+	}, nil
+}
+
+// nodeRecordSize is the on-disk size of one (level, index, hash) record:
+// a 1-byte level, an 8-byte big-endian index, and the hash itself.
+func nodeRecordSize(hashSize int) int64 {
+	return 1 + 8 + int64(hashSize)
+}
+
+func openNodesLog(path string, hashSize int) (map[nodeKey][]byte, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := make(map[nodeKey][]byte)
+	r := bufio.NewReader(f)
+	rec := make([]byte, nodeRecordSize(hashSize))
+	for {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			break
+		}
+		level := rec[0]
+		index := binary.BigEndian.Uint64(rec[1:9])
+		hash := append([]byte(nil), rec[9:]...)
+		nodes[nodeKey{level, index}] = hash
+	}
+	return nodes, f, nil
+}
+
+func openEntriesLog(path string) (uint64, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var count uint64
+	r := bufio.NewReader(f)
+	var lenBuf [4]byte
+	for {
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			break
+		}
+		n := binary.BigEndian.Uint32(lenBuf[:])
+		if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+			break
+		}
+		count++
+	}
+	return count, f, nil
+}
+
+func (s *FileStorage) Get(level uint8, index uint64) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.nodes[nodeKey{level, index}]
+	return h, ok
+}
+
+func (s *FileStorage) Put(level uint8, index uint64, hash []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := nodeKey{level, index}
+	if _, ok := s.nodes[key]; ok {
+		return
+	}
+
+	rec := make([]byte, 0, nodeRecordSize(s.hashSize))
+	rec = append(rec, level)
+	var indexBuf [8]byte
+	binary.BigEndian.PutUint64(indexBuf[:], index)
+	rec = append(rec, indexBuf[:]...)
+	rec = append(rec, hash...)
+	// Put has no error return (see the Storage interface), so a failing
+	// write here is treated as fatal rather than silently dropped: without
+	// it, this node is lost from disk but would look persisted to every
+	// caller, including a future OpenTree.
+	if _, err := s.nodesW.Write(rec); err != nil {
+		panic(fmt.Errorf("merkletree: FileStorage.Put: writing node record: %w", err))
+	}
+
+	s.nodes[key] = append([]byte(nil), hash...)
+}
+
+func (s *FileStorage) AppendEntry(entry []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(entry)))
+	if _, err := s.entriesW.Write(lenBuf[:]); err != nil {
+		return 0, err
+	}
+	if _, err := s.entriesW.Write(entry); err != nil {
+		return 0, err
+	}
+
+	index := s.entryCount
+	s.entryCount++
+	return index, nil
+}
+
+// Size returns the number of entries appended so far, letting OpenTree pick
+// up an existing FileStorage without re-probing it node by node.
+func (s *FileStorage) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entryCount
+}
+
+// Close releases the files backing s.
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.nodesW.Close()
+	if entErr := s.entriesW.Close(); err == nil {
+		err = entErr
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorageSurvivesReopen(t *testing.T) {
+	D := makeleaves()
+	dir := t.TempDir()
+
+	storage, err := NewFileStorage(dir, RFC6962SHA256.Size())
+	assert.NoError(t, err)
+
+	tree := NewTree(D, TreeConfig{Storage: storage})
+	root := tree.Hash()
+	assert.NoError(t, storage.Close())
+
+	reopened, err := NewFileStorage(dir, RFC6962SHA256.Size())
+	assert.NoError(t, err)
+	defer reopened.Close()
+
+	resumed, err := OpenTree(reopened)
+	assert.NoError(t, err)
+	assert.Equal(t, root, resumed.Hash())
+
+	for i, d := range D {
+		path := resumed.Path(uint64(i))
+		assert.NoError(t, VerifyInclusion(d, uint64(i), uint64(len(D)), root, path))
+	}
+
+	// Further appends to the resumed tree must continue from where the
+	// original tree left off.
+	resumed.Append([]byte("d7"))
+	want := NewTree(append(append([][]byte{}, D...), []byte("d7"))).Hash()
+	assert.Equal(t, want, resumed.Hash())
+}
+
+func TestOpenTreeOnMemStorage(t *testing.T) {
+	D := makeleaves()
+	storage := NewMemStorage()
+	tree := NewTree(D, TreeConfig{Storage: storage})
+
+	resumed, err := OpenTree(storage)
+	assert.NoError(t, err)
+	assert.Equal(t, tree.Hash(), resumed.Hash())
+	assert.Equal(t, tree.Proof(4), resumed.Proof(4))
+}
+
+// dropOnePutStorage wraps a Storage and silently discards one Put call,
+// simulating the kind of partial write a crash or I/O error could leave
+// behind.
+type dropOnePutStorage struct {
+	Storage
+	dropLevel uint8
+	dropIndex uint64
+	dropped   bool
+}
+
+func (s *dropOnePutStorage) Put(level uint8, index uint64, hash []byte) {
+	if !s.dropped && level == s.dropLevel && index == s.dropIndex {
+		s.dropped = true
+		return
+	}
+	s.Storage.Put(level, index, hash)
+}
+
+func TestOpenTreeErrorsOnMissingNode(t *testing.T) {
+	D := makeleaves()
+	storage := &dropOnePutStorage{Storage: NewMemStorage(), dropLevel: 2, dropIndex: 0}
+	NewTree(D, TreeConfig{Storage: storage})
+
+	_, err := OpenTree(storage)
+	assert.Error(t, err)
+}
@@ -1,9 +1,18 @@
 // Implementation as per https://tools.ietf.org/html/rfc6962#section-2.1
+//
+// Unlike a naive implementation that re-hashes every entry on each call,
+// Tree is built around the "compact range" technique: the tree is
+// append-only, so the hash of any subtree that is fully to the left of the
+// current right edge can never change once computed. Tree keeps the
+// right-edge subtree roots (one per set bit of the current size) plus a
+// cache of every such frozen node it has ever computed, so Append, Path and
+// Proof only ever do O(log n) work instead of re-walking the whole tree.
 
 package merkletree
 
 import (
-	"crypto/sha256"
+	"fmt"
+	"math/bits"
 )
 
 const (
@@ -12,82 +21,242 @@ const (
 )
 
 type (
-	// Path is a list of nodes required for proving inclusion or consistency.
-	Path [][sha256.Size]byte
+	// Path is a list of node hashes required for proving inclusion or
+	// consistency. Its element size depends on the Tree's Hasher.
+	Path [][]byte
+
+	// nodeKey identifies a node that roots a perfect, 2^level-sized subtree
+	// covering leaves [index*2^level, (index+1)*2^level).
+	nodeKey struct {
+		level uint8
+		index uint64
+	}
 
-	// Tree implements a general purpose Merkle tree.
+	// Tree implements a general purpose, append-only Merkle tree.
 	Tree struct {
-		entries [][]byte
+		hasher  Hasher
+		storage Storage
+		size    uint64
+		// compact holds the root hash of the active 2^level-sized subtree
+		// at the current right edge, or nil if that bit of size is unset.
+		// It is an in-memory fast path only: every entry in it has also
+		// been written through to storage via Put, so it can always be
+		// rebuilt from storage (see OpenTree).
+		compact [][]byte
 	}
 )
 
-func NewTree(entries [][]byte) *Tree {
-	return &Tree{
-		entries: entries,
+// NewTree builds a Tree from entries by appending them in order, using the
+// Hasher and Storage from config if given, or RFC6962SHA256 and an
+// in-memory Storage otherwise.
+func NewTree(entries [][]byte, config ...TreeConfig) *Tree {
+	var cfg TreeConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	t := &Tree{hasher: cfg.hasher(), storage: cfg.storage()}
+	for _, entry := range entries {
+		t.Append(entry)
+	}
+	return t
+}
+
+// sizer is implemented by Storage backends that know how many entries they
+// have already persisted, letting OpenTree resume without probing them one
+// by one.
+type sizer interface {
+	Size() uint64
+}
+
+// OpenTree resumes a Tree backed by a Storage that may already hold entries
+// from a previous run -- for example, a FileStorage reopened after a
+// process restart. The size of the existing tree is read directly from
+// storage if it implements sizer (as MemStorage and FileStorage do), or
+// otherwise found by probing Storage.Get(0, i) with a doubling-then-binary
+// search; the compact range is then rebuilt from the frozen node hashes
+// storage already has, without rehashing a single entry.
+//
+// OpenTree fails with an error rather than returning a Tree with gaps in its
+// compact range: if storage is missing a node it must have for a tree of the
+// size it reports, that storage is corrupt or incomplete, and silently
+// treating the gap as "empty" would make Hash return a wrong root instead of
+// the true one.
+func OpenTree(storage Storage, config ...TreeConfig) (*Tree, error) {
+	var cfg TreeConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if storage == nil {
+		storage = cfg.storage()
+	}
+
+	t := &Tree{hasher: cfg.hasher(), storage: storage, size: existingSize(storage)}
+	if err := t.rebuildCompactRange(); err != nil {
+		return nil, err
 	}
+	return t, nil
 }
 
-func (t *Tree) Hash() [sha256.Size]byte {
-	return t.hash(t.entries)
+func existingSize(storage Storage) uint64 {
+	if s, ok := storage.(sizer); ok {
+		return s.Size()
+	}
+
+	if _, ok := storage.Get(0, 0); !ok {
+		return 0
+	}
+	lo, hi := uint64(0), uint64(1)
+	for {
+		if _, ok := storage.Get(0, hi); !ok {
+			break
+		}
+		lo = hi
+		hi *= 2
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		if _, ok := storage.Get(0, mid); ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo + 1
+}
+
+// rebuildCompactRange repopulates t.compact from the frozen node hashes
+// that t.storage already has for each set bit of t.size. It errors rather
+// than leaving t.compact incomplete if any of those nodes is missing.
+func (t *Tree) rebuildCompactRange() error {
+	var start uint64
+	for level := 63; level >= 0; level-- {
+		size := uint64(1) << uint(level)
+		if t.size&size == 0 {
+			continue
+		}
+		h, ok := t.storage.Get(uint8(level), start/size)
+		if !ok {
+			return fmt.Errorf("merkletree: storage is missing the frozen node at level %d, index %d, needed to reconstruct a tree of size %d", level, start/size, t.size)
+		}
+		for level >= len(t.compact) {
+			t.compact = append(t.compact, nil)
+		}
+		t.compact[level] = h
+		start += size
+	}
+	return nil
 }
 
 /*
-   Logs use a binary Merkle Hash Tree for efficient auditing.  The
-   hashing algorithm is SHA-256 [FIPS.180-4] (note that this is fixed
-   for this experiment, but it is anticipated that each log would be
-   able to specify a hash algorithm).  The input to the Merkle Tree Hash
-   is a list of data entries; these entries will be hashed to form the
-   leaves of the Merkle Hash Tree.  The output is a single 32-byte
-   Merkle Tree Hash.  Given an ordered list of n inputs, D[n] = {d(0),
-   d(1), ..., d(n-1)}, the Merkle Tree Hash (MTH) is thus defined as
-   follows:
+Append adds entry as the next leaf of the tree and returns its index.
+
+Only the new leaf is hashed; the rest of the work is merging it into the
+compact range. This mirrors the RFC 6962 recurrence
+
+	MTH(D[n]) = H(NodePrefix || MTH(D[0:k]) || MTH(D[k:n]))
+
+for the case where appending a leaf causes a perfect subtree to double in
+size: whenever the active subtree at a level is already occupied, the new
+node is combined with it via HashChildren to form the subtree one level up,
+and so on up the right spine until an empty level is found.
 */
-func (t *Tree) hash(D [][]byte) [sha256.Size]byte {
-	n := uint64(len(D))
-	/*
-		The hash of an empty list is the hash of an empty string:
-		MTH({}) = SHA-256().
-	*/
-	if n == 0 {
-		return sha256.Sum256(nil)
-	}
-	/*
-		The hash of a list with one entry (also known as a leaf hash) is:
-		MTH({d(0)}) = SHA-256(0x00 || d(0)).
-	*/
+func (t *Tree) Append(entry []byte) uint64 {
+	if t.hasher == nil {
+		t.hasher = RFC6962SHA256
+	}
+	if t.storage == nil {
+		t.storage = NewMemStorage()
+	}
+
+	// Append's signature predates pluggable Storage and has no error
+	// return; a failing AppendEntry (e.g. a disk write failure) is treated
+	// as fatal rather than silently dropping the entry.
+	leaf, err := t.storage.AppendEntry(entry)
+	if err != nil {
+		panic(err)
+	}
+
+	h := t.hasher.HashLeaf(entry)
+	t.storage.Put(0, leaf, h)
+
+	var level uint8
+	index := leaf
+	for int(level) < len(t.compact) && t.compact[level] != nil {
+		h = t.hasher.HashChildren(t.compact[level], h)
+		t.compact[level] = nil
+		index /= 2
+		level++
+		t.storage.Put(level, index, h)
+	}
+	for int(level) >= len(t.compact) {
+		t.compact = append(t.compact, nil)
+	}
+	t.compact[level] = h
+
+	t.size++
+	return leaf
+}
+
+// Hash returns the Merkle Tree Hash of the entries appended so far, folding
+// the compact range from the smallest active level up: the lowest level is
+// the rightmost subtree, and each larger active level is its left sibling,
+// so the accumulator is nested one level deeper every time it is combined.
+func (t *Tree) Hash() []byte {
+	if t.size == 0 {
+		return t.hasherOrDefault().EmptyRoot()
+	}
+	var acc []byte
+	for level := 0; level < len(t.compact); level++ {
+		if t.compact[level] == nil {
+			continue
+		}
+		if acc == nil {
+			acc = t.compact[level]
+			continue
+		}
+		acc = t.hasher.HashChildren(t.compact[level], acc)
+	}
+	return acc
+}
+
+func (t *Tree) hasherOrDefault() Hasher {
+	if t.hasher == nil {
+		return RFC6962SHA256
+	}
+	return t.hasher
+}
+
+// subMTH returns MTH(D[start:start+n)). Whenever [start, start+n) is a
+// perfect, aligned subtree (n a power of two and start a multiple of n) its
+// hash is looked up in, and memoized into, the frozen cache -- it can only
+// ever be computed once, since such a range never changes after it is first
+// completed. Unaligned ranges (the non-power-of-two tail that original
+// RFC 6962 splitting produces) are cheap to recompute directly, since they
+// are only ever O(log n) deep.
+func (t *Tree) subMTH(start, n uint64) []byte {
 	if n == 1 {
-		c := []byte{LeafPrefix}
-		c = append(c, D[0]...)
-		return sha256.Sum256(c)
-	}
-
-	/*
-		For n > 1, let k be the largest power of two smaller than n (i.e.,
-		k < n <= 2k).  The Merkle Tree Hash of an n-element list D[n] is then
-		defined recursively as
-
-		MTH(D[n]) = SHA-256(0x01 || MTH(D[0:k]) || MTH(D[k:n])),
-
-		where || is concatenation and D[k1:k2] denotes the list {d(k1),
-		d(k1+1),..., d(k2-1)} of length (k2 - k1).  (Note that the hash
-		calculations for leaves and nodes differ.  This domain separation is
-		required to give second preimage resistance.)
-
-		Note that we do not require the length of the input list to be a
-		power of two.  The resulting Merkle Tree may thus not be balanced;
-		however, its shape is uniquely determined by the number of leaves.
-		(Note: This Merkle Tree is essentially the same as the history tree
-		[CrosbyWallach] proposal, except our definition handles non-full
-		trees differently.)
-	*/
+		// Unlike the aligned-subtree case below, a missing leaf hash can
+		// never be recomputed -- there is no raw entry data to rehash it
+		// from -- so it always indicates storage corruption, not an
+		// ordinary cache miss.
+		h, ok := t.storage.Get(0, start)
+		if !ok {
+			panic(fmt.Sprintf("merkletree: missing leaf hash for index %d; storage is corrupt or incomplete", start))
+		}
+		return h
+	}
 	k := largestPowerOf2LessThan(n)
+	if n&(n-1) != 0 {
+		return t.hasher.HashChildren(t.subMTH(start, k), t.subMTH(start+k, n-k))
+	}
 
-	c := []byte{NodePrefix}
-	x := t.hash(D[0:k])
-	c = append(c, x[:]...)
-	x = t.hash(D[k:n])
-	c = append(c, x[:]...)
-	return sha256.Sum256(c)
+	level, index := uint8(bits.Len64(n)-1), start/n
+	if h, ok := t.storage.Get(level, index); ok {
+		return h
+	}
+	h := t.hasher.HashChildren(t.subMTH(start, k), t.subMTH(start+k, n-k))
+	t.storage.Put(level, index, h)
+	return h
 }
 
 func largestPowerOf2LessThan(n uint64) uint64 {
@@ -118,42 +287,22 @@ func largestPowerOf2LessThan(n uint64) uint64 {
    matches the true root, then the audit path is proof that the leaf
    exists in the tree.
 */
-func (t *Tree) Path(m uint64) (path Path) {
-	return t.path(m, t.entries)
+func (t *Tree) Path(m uint64) Path {
+	return t.path(m, 0, t.size)
 }
 
-func (t *Tree) path(m uint64, D [][]byte) Path {
-	/*
-		The path for the single leaf in a tree with a one-element input list
-		D[1] = {d(0)} is empty:
-
-		PATH(0, {d(0)}) = {}
-	*/
-	n := uint64(len(D))
+func (t *Tree) path(m, start, n uint64) Path {
 	p := make(Path, 0)
-	if n == 1 && m == 0 {
+	if n == 1 {
 		return p
 	}
-
-	/*
-		For n > 1, let k be the largest power of two smaller than n.  The
-		path for the (m+1)th element d(m) in a list of n > m elements is then
-		defined recursively as
-
-		PATH(m, D[n]) = PATH(m, D[0:k]) : MTH(D[k:n]) for m < k; and
-
-		PATH(m, D[n]) = PATH(m - k, D[k:n]) : MTH(D[0:k]) for m >= k,
-
-		where : is concatenation of lists and D[k1:k2] denotes the length
-		(k2 - k1) list {d(k1), d(k1+1),..., d(k2-1)} as before.
-	*/
 	k := largestPowerOf2LessThan(n)
 	if m < k {
-		p = append(p, t.path(m, D[0:k])...)
-		p = append(p, t.hash(D[k:n]))
+		p = append(p, t.path(m, start, k)...)
+		p = append(p, t.subMTH(start+k, n-k))
 	} else {
-		p = append(p, t.path(m-k, D[k:n])...)
-		p = append(p, t.hash(D[0:k]))
+		p = append(p, t.path(m-k, start+k, n-k)...)
+		p = append(p, t.subMTH(start, k))
 	}
 	return p
 }
@@ -163,87 +312,32 @@ func (t *Tree) path(m uint64, D [][]byte) Path {
    A Merkle consistency proof for a Merkle Tree Hash MTH(D[n]) and a
    previously advertised hash MTH(D[0:m]) of the first m leaves, m <= n,
    is the list of nodes in the Merkle Tree required to verify that the
-   first m inputs D[0:m] are equal in both trees.  Thus, a consistency
-   proof must contain a set of intermediate nodes (i.e., commitments to
-   inputs) sufficient to verify MTH(D[n]), such that (a subset of) the
-   same nodes can be used to verify MTH(D[0:m]).  We define an algorithm
-   that outputs the (unique) minimal consistency proof.
+   first m inputs D[0:m] are equal in both trees.
 */
 func (t *Tree) Proof(m uint64) Path {
-	return t.proof(m, t.entries)
-}
-
-func (t *Tree) proof(m uint64, D [][]byte) Path {
-	/*
-		Given an ordered list of n inputs to the tree, D[n] = {d(0), ...,
-		d(n-1)}, the Merkle consistency proof PROOF(m, D[n]) for a previous
-		Merkle Tree Hash MTH(D[0:m]), 0 < m < n, is defined as:
-
-		PROOF(m, D[n]) = SUBPROOF(m, D[n], true)
-
-		The subproof for m = n is empty if m is the value for which PROOF was
-		originally requested (meaning that the subtree Merkle Tree Hash
-		MTH(D[0:m]) is known):
-
-		SUBPROOF(m, D[m], true) = {}
-	*/
-	n := uint64(len(D))
-	if 0 < m && m < n {
-		return t.subProof(m, D, true)
+	if 0 < m && m < t.size {
+		return t.subProof(m, 0, t.size, true)
 	}
 	return nil
 }
 
-func (t *Tree) subProof(m uint64, D [][]byte, b bool) Path {
-	/*
-	   The subproof for m = n is the Merkle Tree Hash committing inputs
-	   D[0:m]; otherwise:
-
-	   SUBPROOF(m, D[m], false) = {MTH(D[m])}
-
-	   For m < n, let k be the largest power of two smaller than n.  The
-	   subproof is then defined recursively.
-
-	   If m <= k, the right subtree entries D[k:n] only exist in the current
-	   tree.  We prove that the left subtree entries D[0:k] are consistent
-	   and add a commitment to D[k:n]:
-
-	   SUBPROOF(m, D[n], b) = SUBPROOF(m, D[0:k], b) : MTH(D[k:n])
-
-	   If m > k, the left subtree entries D[0:k] are identical in both
-	   trees.  We prove that the right subtree entries D[k:n] are consistent
-	   and add a commitment to D[0:k].
-
-	   SUBPROOF(m, D[n], b) = SUBPROOF(m - k, D[k:n], false) : MTH(D[0:k])
-
-	   Here, : is a concatenation of lists, and D[k1:k2] denotes the length
-	   (k2 - k1) list {d(k1), d(k1+1),..., d(k2-1)} as before.
-
-	   The number of nodes in the resulting proof is bounded above by
-	   ceil(log2(n)) + 1.
-
-	*/
-
+func (t *Tree) subProof(m, start, n uint64, b bool) Path {
 	path := make(Path, 0)
-	n := uint64(len(D))
 
 	if m == n {
 		if !b {
-			path = append(path, t.hash(D))
+			path = append(path, t.subMTH(start, n))
 		}
 		return path
 	}
 
-	if m < n {
-		k := largestPowerOf2LessThan(n)
-
-		if m <= k {
-			path = append(path, t.subProof(m, D[0:k], b)...)
-			path = append(path, t.hash(D[k:n]))
-		} else {
-			path = append(path, t.subProof(m-k, D[k:n], false)...)
-			path = append(path, t.hash(D[0:k]))
-		}
+	k := largestPowerOf2LessThan(n)
+	if m <= k {
+		path = append(path, t.subProof(m, start, k, b)...)
+		path = append(path, t.subMTH(start+k, n-k))
+	} else {
+		path = append(path, t.subProof(m-k, start+k, n-k, false)...)
+		path = append(path, t.subMTH(start, k))
 	}
 	return path
 }
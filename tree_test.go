@@ -107,3 +107,17 @@ func TestConsistencyProof(t *testing.T) {
 	path = tree.Proof(6)
 	assert.Len(t, path, 3)
 }
+
+func TestIncrementalAppendMatchesBulkConstruction(t *testing.T) {
+	D := makeleaves()
+
+	incremental := &Tree{}
+	for n, entry := range D {
+		assert.EqualValues(t, n, incremental.Append(entry))
+
+		bulk := NewTree(D[:n+1])
+		assert.Equal(t, bulk.Hash(), incremental.Hash())
+		assert.Equal(t, bulk.Path(0), incremental.Path(0))
+		assert.Equal(t, bulk.Path(uint64(n)), incremental.Path(uint64(n)))
+	}
+}
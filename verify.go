@@ -0,0 +1,169 @@
+// Implementation as per https://tools.ietf.org/html/rfc6962#section-2.1.1
+// and https://tools.ietf.org/html/rfc6962#section-2.1.2
+
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+)
+
+/*
+VerifyInclusion checks that the Merkle audit path proves that leaf is
+present at index in a tree of size treeSize with the given root hash, using
+c's Hasher (RFC6962SHA256 if c.Hasher is nil).
+
+The audit path is walked from the leaf towards the root: at each level the
+running hash is combined with the next path element on the side dictated by
+the binary decomposition of index relative to the current subtree boundary
+(lastNode), exactly as a verifier constructs PATH(m, D[n]) in reverse (see
+https://tools.ietf.org/html/rfc6962#section-2.1.1).
+*/
+func (c TreeConfig) VerifyInclusion(leaf []byte, index, treeSize uint64, root []byte, path Path) error {
+	if treeSize == 0 {
+		return errors.New("merkletree: tree is empty")
+	}
+	if index >= treeSize {
+		return errors.New("merkletree: index out of range")
+	}
+
+	hasher := c.hasher()
+	node := index
+	lastNode := treeSize - 1
+	hash := hasher.HashLeaf(leaf)
+	proofIndex := 0
+
+	for lastNode > 0 {
+		if proofIndex >= len(path) {
+			return errors.New("merkletree: inclusion proof is too short")
+		}
+		if node%2 == 1 {
+			hash = hasher.HashChildren(path[proofIndex], hash)
+			proofIndex++
+		} else if node < lastNode {
+			hash = hasher.HashChildren(hash, path[proofIndex])
+			proofIndex++
+		}
+		node /= 2
+		lastNode /= 2
+	}
+
+	if proofIndex != len(path) {
+		return errors.New("merkletree: inclusion proof has too many elements")
+	}
+	if !bytes.Equal(hash, root) {
+		return errors.New("merkletree: calculated root does not match given root")
+	}
+	return nil
+}
+
+/*
+VerifyConsistency checks that proof demonstrates that the tree of size
+newSize with root newRoot is an append-only extension of the tree of size
+oldSize with root oldRoot, per SUBPROOF(m, D[n], true) in
+https://tools.ietf.org/html/rfc6962#section-2.1.2, using c's Hasher
+(RFC6962SHA256 if c.Hasher is nil).
+
+As with PROOF(m, D[n]), the proof is empty when oldSize == newSize (the two
+trees are identical and oldRoot must equal newRoot). Otherwise the first
+hash consumed from proof seeds both the reconstructed old and new roots,
+unless oldSize is itself a power of two, in which case MTH(D[0:oldSize]) is
+already fully determined and oldRoot is used as that seed directly.
+*/
+func (c TreeConfig) VerifyConsistency(oldSize, newSize uint64, oldRoot, newRoot []byte, proof Path) error {
+	if oldSize > newSize {
+		return errors.New("merkletree: oldSize is larger than newSize")
+	}
+	if oldSize == newSize {
+		if len(proof) > 0 {
+			return errors.New("merkletree: expected empty proof for equal tree sizes")
+		}
+		if !bytes.Equal(oldRoot, newRoot) {
+			return errors.New("merkletree: roots of equal-size trees do not match")
+		}
+		return nil
+	}
+	if oldSize == 0 {
+		if len(proof) > 0 {
+			return errors.New("merkletree: expected empty proof for empty old tree")
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return errors.New("merkletree: consistency proof is empty")
+	}
+
+	hasher := c.hasher()
+	node := oldSize - 1
+	lastNode := newSize - 1
+	proofIndex := 0
+
+	for node%2 == 1 {
+		node /= 2
+		lastNode /= 2
+	}
+
+	var oldHash, newHash []byte
+	if node > 0 {
+		oldHash = proof[proofIndex]
+		newHash = proof[proofIndex]
+		proofIndex++
+	} else {
+		// oldSize is a power of two, so MTH(D[0:oldSize]) is already known.
+		oldHash = oldRoot
+		newHash = oldRoot
+	}
+
+	for node > 0 {
+		if proofIndex >= len(proof) {
+			return errors.New("merkletree: consistency proof is too short")
+		}
+		if node%2 == 1 {
+			oldHash = hasher.HashChildren(proof[proofIndex], oldHash)
+			newHash = hasher.HashChildren(proof[proofIndex], newHash)
+			proofIndex++
+		} else if node < lastNode {
+			if proofIndex >= len(proof) {
+				return errors.New("merkletree: consistency proof is too short")
+			}
+			newHash = hasher.HashChildren(newHash, proof[proofIndex])
+			proofIndex++
+		}
+		node /= 2
+		lastNode /= 2
+	}
+
+	for lastNode > 0 {
+		if proofIndex >= len(proof) {
+			return errors.New("merkletree: consistency proof is too short")
+		}
+		newHash = hasher.HashChildren(newHash, proof[proofIndex])
+		proofIndex++
+		lastNode /= 2
+	}
+
+	if proofIndex != len(proof) {
+		return errors.New("merkletree: consistency proof has too many elements")
+	}
+	if !bytes.Equal(oldHash, oldRoot) {
+		return errors.New("merkletree: calculated old root does not match given old root")
+	}
+	if !bytes.Equal(newHash, newRoot) {
+		return errors.New("merkletree: calculated new root does not match given new root")
+	}
+	return nil
+}
+
+// VerifyInclusion checks an inclusion proof using RFC6962SHA256. It is a
+// convenience wrapper around TreeConfig{}.VerifyInclusion for callers that
+// do not need an alternate Hasher.
+func VerifyInclusion(leaf []byte, index, treeSize uint64, root []byte, path Path) error {
+	return TreeConfig{}.VerifyInclusion(leaf, index, treeSize, root, path)
+}
+
+// VerifyConsistency checks a consistency proof using RFC6962SHA256. It is a
+// convenience wrapper around TreeConfig{}.VerifyConsistency for callers
+// that do not need an alternate Hasher.
+func VerifyConsistency(oldSize, newSize uint64, oldRoot, newRoot []byte, proof Path) error {
+	return TreeConfig{}.VerifyConsistency(oldSize, newSize, oldRoot, newRoot, proof)
+}
@@ -0,0 +1,44 @@
+// Implementation as per https://tools.ietf.org/html/rfc6962#section-2.1.1
+// and https://tools.ietf.org/html/rfc6962#section-2.1.2
+
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyInclusion(t *testing.T) {
+	D := makeleaves()
+	tree := NewTree(D)
+	root := tree.Hash()
+
+	for i, d := range D {
+		path := tree.Path(uint64(i))
+		assert.NoError(t, VerifyInclusion(d, uint64(i), uint64(len(D)), root, path))
+	}
+
+	// A wrong leaf should fail verification.
+	path := tree.Path(0)
+	assert.Error(t, VerifyInclusion([]byte("not-d0"), 0, uint64(len(D)), root, path))
+
+	// A path that is too short should fail verification.
+	assert.Error(t, VerifyInclusion(D[0], 0, uint64(len(D)), root, path[:len(path)-1]))
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	D := makeleaves()
+	tree := NewTree(D)
+
+	for _, m := range []uint64{3, 4, 6} {
+		oldRoot := NewTree(D[:m]).Hash()
+		newRoot := tree.Hash()
+		proof := tree.Proof(m)
+		assert.NoError(t, VerifyConsistency(m, uint64(len(D)), oldRoot, newRoot, proof))
+	}
+
+	// Equal sizes require an empty proof and matching roots.
+	root := tree.Hash()
+	assert.NoError(t, VerifyConsistency(uint64(len(D)), uint64(len(D)), root, root, nil))
+}